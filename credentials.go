@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+)
+
+// CredentialsMode selects how an AccountConfig's credentials are resolved.
+type CredentialsMode string
+
+const (
+	// CredentialsModeStatic uses the AccessKey/SecretKey pair verbatim. This
+	// is the default when CredentialsMode is unset.
+	CredentialsModeStatic CredentialsMode = "static"
+	// CredentialsModeEC2Role fetches credentials from the EC2 instance
+	// metadata service.
+	CredentialsModeEC2Role CredentialsMode = "ec2_role"
+	// CredentialsModeIAMRole assumes an IAM role via IRSA-style web identity
+	// federation, as used by EKS service accounts.
+	CredentialsModeIAMRole CredentialsMode = "iam_role"
+	// CredentialsModeSharedProfile reads credentials from the shared AWS
+	// credentials/config files, using AccountConfig.Profile.
+	CredentialsModeSharedProfile CredentialsMode = "shared_profile"
+	// CredentialsModeEnv reads credentials from the AWS_ACCESS_KEY_ID /
+	// AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN environment variables.
+	CredentialsModeEnv CredentialsMode = "env"
+)
+
+// buildAWSConfig resolves an aws.Config for acct according to its
+// CredentialsMode. It does not apply acct.Endpoint, UsePathStyle or
+// DisableSSL; newS3Client applies those when building the S3 client.
+func buildAWSConfig(ctx context.Context, acct AccountConfig, maxRetries int) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(acct.Region),
+		awsconfig.WithRetryMaxAttempts(maxRetries),
+		awsconfig.WithRetryMode(aws.RetryModeStandard),
+	}
+
+	switch acct.CredentialsMode {
+	case "", CredentialsModeStatic:
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(acct.AccessKey, acct.SecretKey, ""),
+		))
+	case CredentialsModeEC2Role:
+		client := imds.New(imds.Options{})
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			aws.NewCredentialsCache(ec2rolecreds.New(func(o *ec2rolecreds.Options) {
+				o.Client = client
+			})),
+		))
+	case CredentialsModeIAMRole:
+		// With no RoleARN configured, there's nothing to assume explicitly;
+		// fall through to the default chain, which already performs this
+		// same AssumeRoleWithWebIdentity exchange itself when EKS sets
+		// AWS_ROLE_ARN/AWS_WEB_IDENTITY_TOKEN_FILE.
+		if acct.RoleARN != "" {
+			baseCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(acct.Region))
+			if err != nil {
+				return aws.Config{}, fmt.Errorf("failed to load base config for iam_role credentials: %w", err)
+			}
+			tokenFile := acct.WebIdentityTokenFile
+			if tokenFile == "" {
+				tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+			}
+			if tokenFile == "" {
+				return aws.Config{}, fmt.Errorf("credentials_mode iam_role with role_arn set requires web_identity_token_file or AWS_WEB_IDENTITY_TOKEN_FILE")
+			}
+			stsClient := sts.NewFromConfig(baseCfg)
+			opts = append(opts, awsconfig.WithCredentialsProvider(
+				aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+					stsClient, acct.RoleARN, stscreds.IdentityTokenFile(tokenFile),
+				)),
+			))
+		}
+	case CredentialsModeSharedProfile:
+		opts = append(opts, awsconfig.WithSharedConfigProfile(acct.Profile))
+	case CredentialsModeEnv:
+		// The default credential chain already checks
+		// AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN, so no
+		// extra provider is needed here.
+	default:
+		return aws.Config{}, fmt.Errorf("unknown credentials_mode %q", acct.CredentialsMode)
+	}
+
+	return awsconfig.LoadDefaultConfig(ctx, opts...)
+}
+
+// newS3Client builds an *s3.Client for acct, applying UsePathStyle and a
+// custom endpoint resolver when acct.Endpoint targets a non-AWS
+// S3-compatible service.
+func newS3Client(cfg aws.Config, acct AccountConfig) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = acct.UsePathStyle
+		if acct.Endpoint != "" {
+			o.EndpointResolverV2 = staticEndpointResolver{endpoint: acct.Endpoint, disableSSL: acct.DisableSSL}
+		}
+	})
+}
+
+// staticEndpointResolver resolves every S3 operation to a single configured
+// endpoint, bypassing the AWS region-based resolver.
+type staticEndpointResolver struct {
+	endpoint   string
+	disableSSL bool
+}
+
+func (r staticEndpointResolver) ResolveEndpoint(ctx context.Context, params s3.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	endpoint := r.endpoint
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https"
+		if r.disableSSL {
+			scheme = "http"
+		}
+		endpoint = scheme + "://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return smithyendpoints.Endpoint{}, fmt.Errorf("failed to parse endpoint %q: %w", r.endpoint, err)
+	}
+
+	return smithyendpoints.Endpoint{URI: *u}, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBuildAWSConfigUnknownCredentialsMode(t *testing.T) {
+	_, err := buildAWSConfig(context.Background(), AccountConfig{CredentialsMode: "bogus"}, 3)
+	if err == nil {
+		t.Fatal("expected an error for an unknown credentials_mode, got nil")
+	}
+}
+
+func TestBuildAWSConfigIAMRoleRequiresTokenFile(t *testing.T) {
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+
+	_, err := buildAWSConfig(context.Background(), AccountConfig{
+		CredentialsMode: CredentialsModeIAMRole,
+		RoleARN:         "arn:aws:iam::123456789012:role/example",
+	}, 3)
+	if err == nil {
+		t.Fatal("expected an error when role_arn is set without a web identity token file, got nil")
+	}
+}
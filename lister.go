@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// listConcurrency bounds how many common-prefix branches are listed
+// concurrently, independent of the copy-worker Concurrency setting.
+const listConcurrency = 8
+
+// matchesFilters reports whether key should be synced given cfg's Include
+// and Exclude glob patterns (matched with path.Match against the full key).
+// Keys under deleteTombstonePrefix are always excluded: they're version-sync
+// bookkeeping, not data, and must never be touched by mirror-delete,
+// bidirectional merge, or a plain copy.
+func matchesFilters(cfg Config, key string) bool {
+	if strings.HasPrefix(key, deleteTombstonePrefix) {
+		return false
+	}
+
+	if len(cfg.Include) > 0 {
+		included := false
+		for _, pattern := range cfg.Include {
+			if ok, _ := path.Match(pattern, key); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, pattern := range cfg.Exclude {
+		if ok, _ := path.Match(pattern, key); ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listObjectsAsync fans out ListObjectsV2 calls by common prefix (splitting
+// the keyspace with Delimiter "/" recursively) and streams matching objects
+// into the returned channel as they're discovered, instead of materializing
+// the full listing in memory before copying starts. The channel is closed
+// once listing completes; the returned function blocks for the listing
+// goroutines to finish and returns the first listing error, if any.
+func listObjectsAsync(ctx context.Context, client *s3.Client, cfg Config) (<-chan types.Object, func() error) {
+	out := make(chan types.Object, cfg.Concurrency)
+	g, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, listConcurrency)
+
+	var listPrefix func(prefix string)
+	listPrefix = func(prefix string) {
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			input := &s3.ListObjectsV2Input{
+				Bucket:    aws.String(cfg.Source.Bucket),
+				Prefix:    aws.String(prefix),
+				Delimiter: aws.String("/"),
+			}
+			for {
+				recordAPICall("ListObjectsV2")
+				output, err := client.ListObjectsV2(ctx, input)
+				if err != nil {
+					return fmt.Errorf("failed to list objects under prefix %q: %w", prefix, err)
+				}
+
+				for _, obj := range output.Contents {
+					key := aws.ToString(obj.Key)
+					if !matchesFilters(cfg, key) {
+						continue
+					}
+					select {
+					case out <- obj:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+
+				for _, common := range output.CommonPrefixes {
+					listPrefix(aws.ToString(common.Prefix))
+				}
+
+				if output.NextContinuationToken == nil || *output.NextContinuationToken == "" {
+					break
+				}
+				input.ContinuationToken = output.NextContinuationToken
+			}
+
+			return nil
+		})
+	}
+
+	listPrefix(cfg.Prefix)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Wait()
+		close(out)
+	}()
+
+	return out, func() error { return <-done }
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestMatchesFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		key  string
+		want bool
+	}{
+		{
+			name: "no filters matches everything",
+			cfg:  Config{},
+			key:  "logs/2024/01/01.log",
+			want: true,
+		},
+		{
+			name: "include matches",
+			cfg:  Config{Include: []string{"logs/*/01/*.log"}},
+			key:  "logs/2024/01/01.log",
+			want: true,
+		},
+		{
+			name: "include does not match",
+			cfg:  Config{Include: []string{"images/*.png"}},
+			key:  "logs/2024/01/01.log",
+			want: false,
+		},
+		{
+			name: "exclude overrides include",
+			cfg:  Config{Include: []string{"logs/*"}, Exclude: []string{"logs/*.tmp"}},
+			key:  "logs/scratch.tmp",
+			want: false,
+		},
+		{
+			name: "exclude without include",
+			cfg:  Config{Exclude: []string{"*.tmp"}},
+			key:  "data.csv",
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesFilters(tt.cfg, tt.key); got != tt.want {
+				t.Errorf("matchesFilters(%+v, %q) = %v, want %v", tt.cfg, tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/sirupsen/logrus"
+
+// logger is the process-wide structured logger. Call sites attach fields
+// such as bucket, key, size, and attempt instead of interpolating them into
+// a free-form message.
+var logger = logrus.New()
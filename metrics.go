@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	objectsCopiedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "s3_sync_objects_copied_total",
+		Help: "Total number of objects copied from source to destination.",
+	})
+	objectsSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "s3_sync_objects_skipped_total",
+		Help: "Total number of objects skipped because they were already up-to-date.",
+	})
+	bytesTransferredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "s3_sync_bytes_transferred_total",
+		Help: "Total number of bytes copied from source to destination.",
+	})
+	apiCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "s3_sync_api_calls_total",
+		Help: "Total number of S3 API calls made, by operation. Bucket policy, versioning and lifecycle calls are not counted, and a multipart download or upload counts as a single GetObject or PutObject call.",
+	}, []string{"operation"})
+
+	copyLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "s3_sync_copy_latency_seconds",
+		Help:    "Latency of copying a single object from source to destination.",
+		Buckets: prometheus.DefBuckets,
+	})
+	verifyLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "s3_sync_verify_latency_seconds",
+		Help:    "Latency of verifying a single copied object.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// recordAPICall increments the api-calls counter for operation.
+func recordAPICall(operation string) {
+	apiCallsTotal.WithLabelValues(operation).Inc()
+}
+
+// startMetricsServer starts a background HTTP server exposing Prometheus
+// metrics at /metrics on addr.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.WithError(err).WithField("addr", addr).Fatal("Metrics server failed")
+		}
+	}()
+
+	logger.WithField("addr", addr).Info("Started Prometheus metrics server")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// objectStateBucket is the single BoltDB bucket used to store one record per
+// synced key.
+var objectStateBucket = []byte("objects")
+
+// ObjectState is the manifest record persisted per key so subsequent runs
+// can tell whether the source listing still matches what was last synced,
+// without a destination HeadObject call.
+type ObjectState struct {
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	VersionID    string    `json:"version_id,omitempty"`
+	LastSyncedAt time.Time `json:"last_synced_at"`
+}
+
+// StateStore is a BoltDB-backed manifest of sourceBucket/key -> ObjectState,
+// used to skip destination HeadObject calls for unchanged objects and to
+// resume an interrupted sync from the last committed key.
+type StateStore struct {
+	db *bolt.DB
+}
+
+// OpenStateStore opens (creating if necessary) a BoltDB state file at path.
+func OpenStateStore(path string) (*StateStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(objectStateBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state file %s: %w", path, err)
+	}
+
+	return &StateStore{db: db}, nil
+}
+
+// Get returns the recorded state for key, if any.
+func (s *StateStore) Get(key string) (ObjectState, bool, error) {
+	var state ObjectState
+	var found bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(objectStateBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &state)
+	})
+	if err != nil {
+		return ObjectState{}, false, fmt.Errorf("failed to read state for %s: %w", key, err)
+	}
+
+	return state, found, nil
+}
+
+// Put persists state for key, committing progress immediately so an
+// interrupted run resumes from the last committed key rather than
+// restarting.
+func (s *StateStore) Put(key string, state ObjectState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state for %s: %w", key, err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(objectStateBucket).Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to persist state for %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Close releases the underlying BoltDB file handle.
+func (s *StateStore) Close() error {
+	return s.db.Close()
+}
+
+// recordObjectState persists obj's current ETag/Size into the state store,
+// a no-op when no state store is configured.
+func recordObjectState(state *StateStore, key string, obj types.Object) error {
+	if state == nil {
+		return nil
+	}
+
+	var lastModified time.Time
+	if obj.LastModified != nil {
+		lastModified = *obj.LastModified
+	}
+
+	return state.Put(key, ObjectState{
+		ETag:         *obj.ETag,
+		Size:         *obj.Size,
+		LastModified: lastModified,
+		LastSyncedAt: time.Now(),
+	})
+}
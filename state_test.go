@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestObjectStateJSONRoundTrip(t *testing.T) {
+	want := ObjectState{
+		ETag:         `"abc123"`,
+		Size:         4096,
+		LastModified: time.Date(2024, 3, 15, 12, 30, 0, 0, time.UTC),
+		VersionID:    "v1",
+		LastSyncedAt: time.Date(2024, 3, 15, 12, 31, 0, 0, time.UTC),
+	}
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got ObjectState
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("round-tripped ObjectState = %+v, want %+v", got, want)
+	}
+}
+
+func TestObjectStateJSONOmitsEmptyVersionID(t *testing.T) {
+	state := ObjectState{ETag: `"abc123"`, Size: 10}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var asMap map[string]interface{}
+	if err := json.Unmarshal(data, &asMap); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if _, ok := asMap["version_id"]; ok {
+		t.Errorf("expected version_id to be omitted when empty, got %+v", asMap)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/sirupsen/logrus"
+)
+
+// SyncMode selects how the destination bucket is kept in sync with the
+// source.
+type SyncMode string
+
+const (
+	// SyncModeAdditive only copies new or changed objects; keys deleted from
+	// the source remain in the destination. This is the default.
+	SyncModeAdditive SyncMode = "additive"
+	// SyncModeMirror behaves like additive, then deletes destination keys
+	// absent from the source.
+	SyncModeMirror SyncMode = "mirror"
+	// SyncModeBidirectional merges newer objects in either direction.
+	SyncModeBidirectional SyncMode = "bidirectional"
+)
+
+// ConflictPolicy resolves which side wins in bidirectional sync when the
+// same key has diverged on both sides.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySourceWins keeps the source's version. This is the
+	// default.
+	ConflictPolicySourceWins ConflictPolicy = "source-wins"
+	// ConflictPolicyDestWins keeps the destination's version.
+	ConflictPolicyDestWins ConflictPolicy = "dest-wins"
+	// ConflictPolicyNewestWins keeps whichever side has the more recent
+	// LastModified.
+	ConflictPolicyNewestWins ConflictPolicy = "newest-wins"
+)
+
+// mirrorDeleteExtras removes destination keys absent from the source
+// bucket, batching DeleteObjects calls at up to 1000 keys per request. When
+// confirmDelete is false it only logs the keys that would be deleted.
+func mirrorDeleteExtras(ctx context.Context, sourceClient, destClient *s3.Client, cfg Config, confirmDelete bool) error {
+	sourceKeys, err := listAllKeys(ctx, sourceClient, cfg, cfg.Source.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to list source keys for mirror delete: %w", err)
+	}
+
+	destKeys, err := listAllKeys(ctx, destClient, cfg, cfg.Destination.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to list destination keys for mirror delete: %w", err)
+	}
+
+	var extras []string
+	for key := range destKeys {
+		if !sourceKeys[key] {
+			extras = append(extras, key)
+		}
+	}
+
+	if len(extras) == 0 {
+		logger.Info("Mirror delete: destination already matches source, nothing to delete")
+		return nil
+	}
+
+	if !confirmDelete {
+		logger.WithField("count", len(extras)).Warn("Mirror delete: dry run, pass --confirm-delete to actually delete these keys")
+		for _, key := range extras {
+			logger.WithField("key", key).Info("Would delete from destination")
+		}
+		return nil
+	}
+
+	for i := 0; i < len(extras); i += 1000 {
+		end := i + 1000
+		if end > len(extras) {
+			end = len(extras)
+		}
+		batch := extras[i:end]
+
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for j, key := range batch {
+			objects[j] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		recordAPICall("DeleteObjects")
+		if _, err := destClient.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(cfg.Destination.Bucket),
+			Delete: &types.Delete{Objects: objects},
+		}); err != nil {
+			return fmt.Errorf("failed to batch-delete destination extras: %w", err)
+		}
+	}
+
+	logger.WithField("count", len(extras)).Info("Mirror delete: removed destination keys absent from source")
+	return nil
+}
+
+// listAllKeys pages through ListObjectsV2 for bucket, scoped to cfg.Prefix
+// and filtered through matchesFilters, and returns the set of every matching
+// key present. Keys outside cfg's Prefix/Include/Exclude scope are excluded
+// so destructive operations like mirror delete never touch objects the rest
+// of the sync was never asked to manage.
+func listAllKeys(ctx context.Context, client *s3.Client, cfg Config, bucket string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(cfg.Prefix)}
+	for {
+		recordAPICall("ListObjectsV2")
+		output, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range output.Contents {
+			key := aws.ToString(obj.Key)
+			if !matchesFilters(cfg, key) {
+				continue
+			}
+			keys[key] = true
+		}
+		if output.NextContinuationToken == nil || *output.NextContinuationToken == "" {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	return keys, nil
+}
+
+// conflictWinner identifies which side should be copied over the other when
+// resolving a bidirectional sync conflict.
+type conflictWinner int
+
+const (
+	conflictWinnerSource conflictWinner = iota
+	conflictWinnerDest
+)
+
+// resolveConflict decides which side wins when the same key has diverged on
+// both sides, per policy. Defaults to source-wins when policy is unset.
+func resolveConflict(policy ConflictPolicy, srcObj, destObj types.Object) conflictWinner {
+	switch policy {
+	case ConflictPolicyDestWins:
+		return conflictWinnerDest
+	case ConflictPolicyNewestWins:
+		if srcObj.LastModified != nil && destObj.LastModified != nil && destObj.LastModified.After(*srcObj.LastModified) {
+			return conflictWinnerDest
+		}
+		return conflictWinnerSource
+	default:
+		return conflictWinnerSource
+	}
+}
+
+// syncBidirectional merges objects in both directions: for keys present on
+// only one side, it copies them to the other; for keys present on both with
+// diverging ETags, it copies whichever side cfg.ConflictPolicy picks.
+func syncBidirectional(ctx context.Context, sourceClient, destClient *s3.Client, cfg Config) error {
+	sourceObjects, err := listAllObjects(ctx, sourceClient, cfg, cfg.Source.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to list source objects for bidirectional sync: %w", err)
+	}
+	destObjects, err := listAllObjects(ctx, destClient, cfg, cfg.Destination.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to list destination objects for bidirectional sync: %w", err)
+	}
+
+	var toDest, toSource int
+	for key, srcObj := range sourceObjects {
+		destObj, existsInDest := destObjects[key]
+		if !existsInDest {
+			if err := copyAndVerifyObject(ctx, sourceClient, destClient, cfg, cfg.Source.Bucket, cfg.Destination.Bucket, key, *srcObj.Size, *srcObj.ETag); err != nil {
+				return err
+			}
+			toDest++
+			continue
+		}
+		if *srcObj.ETag == *destObj.ETag {
+			continue
+		}
+		if resolveConflict(cfg.ConflictPolicy, srcObj, destObj) == conflictWinnerSource {
+			if err := copyAndVerifyObject(ctx, sourceClient, destClient, cfg, cfg.Source.Bucket, cfg.Destination.Bucket, key, *srcObj.Size, *srcObj.ETag); err != nil {
+				return err
+			}
+			toDest++
+		}
+	}
+
+	for key, destObj := range destObjects {
+		srcObj, existsInSource := sourceObjects[key]
+		if !existsInSource {
+			if err := copyAndVerifyObject(ctx, destClient, sourceClient, cfg, cfg.Destination.Bucket, cfg.Source.Bucket, key, *destObj.Size, *destObj.ETag); err != nil {
+				return err
+			}
+			toSource++
+			continue
+		}
+		if *srcObj.ETag == *destObj.ETag {
+			continue
+		}
+		if resolveConflict(cfg.ConflictPolicy, srcObj, destObj) == conflictWinnerDest {
+			if err := copyAndVerifyObject(ctx, destClient, sourceClient, cfg, cfg.Destination.Bucket, cfg.Source.Bucket, key, *destObj.Size, *destObj.ETag); err != nil {
+				return err
+			}
+			toSource++
+		}
+	}
+
+	logger.WithFields(logrus.Fields{"copied_to_dest": toDest, "copied_to_source": toSource}).Info("Bidirectional synchronization completed")
+	return nil
+}
+
+// listAllObjects pages through ListObjectsV2 for bucket, scoped to
+// cfg.Prefix and filtered through matchesFilters, and returns every matching
+// object keyed by its key. Applying the same scoping as listObjectsAsync
+// keeps bidirectional merge from pulling in objects the rest of the sync
+// was never asked to manage.
+func listAllObjects(ctx context.Context, client *s3.Client, cfg Config, bucket string) (map[string]types.Object, error) {
+	objects := make(map[string]types.Object)
+
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(cfg.Prefix)}
+	for {
+		recordAPICall("ListObjectsV2")
+		output, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range output.Contents {
+			key := aws.ToString(obj.Key)
+			if !matchesFilters(cfg, key) {
+				continue
+			}
+			objects[key] = obj
+		}
+		if output.NextContinuationToken == nil || *output.NextContinuationToken == "" {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestResolveConflict(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy ConflictPolicy
+		src    types.Object
+		dest   types.Object
+		want   conflictWinner
+	}{
+		{
+			name:   "default policy keeps source",
+			policy: "",
+			src:    types.Object{LastModified: aws.Time(older)},
+			dest:   types.Object{LastModified: aws.Time(newer)},
+			want:   conflictWinnerSource,
+		},
+		{
+			name:   "source-wins keeps source regardless of timestamps",
+			policy: ConflictPolicySourceWins,
+			src:    types.Object{LastModified: aws.Time(older)},
+			dest:   types.Object{LastModified: aws.Time(newer)},
+			want:   conflictWinnerSource,
+		},
+		{
+			name:   "dest-wins keeps destination regardless of timestamps",
+			policy: ConflictPolicyDestWins,
+			src:    types.Object{LastModified: aws.Time(newer)},
+			dest:   types.Object{LastModified: aws.Time(older)},
+			want:   conflictWinnerDest,
+		},
+		{
+			name:   "newest-wins picks the later destination",
+			policy: ConflictPolicyNewestWins,
+			src:    types.Object{LastModified: aws.Time(older)},
+			dest:   types.Object{LastModified: aws.Time(newer)},
+			want:   conflictWinnerDest,
+		},
+		{
+			name:   "newest-wins picks the later source",
+			policy: ConflictPolicyNewestWins,
+			src:    types.Object{LastModified: aws.Time(newer)},
+			dest:   types.Object{LastModified: aws.Time(older)},
+			want:   conflictWinnerSource,
+		},
+		{
+			name:   "newest-wins falls back to source when timestamps are missing",
+			policy: ConflictPolicyNewestWins,
+			src:    types.Object{},
+			dest:   types.Object{},
+			want:   conflictWinnerSource,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveConflict(tt.policy, tt.src, tt.dest); got != tt.want {
+				t.Errorf("resolveConflict(%q, ...) = %v, want %v", tt.policy, got, tt.want)
+			}
+		})
+	}
+}
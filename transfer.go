@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/sirupsen/logrus"
+)
+
+// streamCopyAndVerifyObject copies an object too large for a single
+// CopyObject call (or large enough that its ETag can't be trusted for
+// equality checks, since multipart ETags aren't content hashes) through a
+// download/upload pipeline instead. The object is downloaded in full to a
+// temp file; its whole-object SHA-256 checksum is then computed by reading
+// that file back, not while the bytes are in transit, and the file is
+// uploaded from there. The upload is verified by re-downloading the
+// uploaded object and hashing it the same way. S3's own ChecksumSHA256 is
+// only usable as a
+// cheap auxiliary check: for objects uploaded as multipart, it's a
+// composite hash of each part's checksum (formatted "<base64>-<N>"), not a
+// whole-object hash, so it can't be compared against our local digest and
+// is skipped whenever either side reports that format.
+func streamCopyAndVerifyObject(ctx context.Context, sourceClient, destClient *s3.Client, cfg Config, sourceBucket, destBucket, key string, sourceSize int64) error {
+	tmp, err := os.CreateTemp("", "s3-sync-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	copyStart := time.Now()
+
+	downloader := manager.NewDownloader(sourceClient, func(d *manager.Downloader) {
+		d.PartSize = cfg.PartSize
+		d.Concurrency = cfg.ReadConcurrency
+	})
+
+	recordAPICall("GetObject")
+	if _, err := downloader.Download(ctx, tmp, &s3.GetObjectInput{
+		Bucket:       aws.String(sourceBucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}); err != nil {
+		return fmt.Errorf("failed to download source object %s: %w", key, err)
+	}
+
+	hasher := sha256.New()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind staging file for %s: %w", key, err)
+	}
+	if _, err := io.Copy(hasher, tmp); err != nil {
+		return fmt.Errorf("failed to checksum staging file for %s: %w", key, err)
+	}
+	sourceChecksum := hex.EncodeToString(hasher.Sum(nil))
+
+	recordAPICall("HeadObject")
+	headOutput, err := sourceClient.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(sourceBucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to head source object %s: %w", key, err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind staging file for %s: %w", key, err)
+	}
+
+	recordAPICall("GetObjectTagging")
+	tagOutput, err := sourceClient.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(sourceBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get source object tags for %s: %w", key, err)
+	}
+
+	uploader := manager.NewUploader(destClient, func(u *manager.Uploader) {
+		u.PartSize = cfg.PartSize
+		u.Concurrency = cfg.WriteConcurrency
+	})
+
+	recordAPICall("PutObject")
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(destBucket),
+		Key:               aws.String(key),
+		Body:              tmp,
+		StorageClass:      headOutput.StorageClass,
+		Metadata:          headOutput.Metadata,
+		ContentType:       headOutput.ContentType,
+		Tagging:           aws.String(encodeTagging(tagOutput.TagSet)),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload object %s: %w", key, err)
+	}
+	copyLatency.Observe(time.Since(copyStart).Seconds())
+
+	verifyStart := time.Now()
+	recordAPICall("HeadObject")
+	verifyOutput, err := destClient.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(destBucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify uploaded object %s: %w", key, err)
+	}
+	verifyLatency.Observe(time.Since(verifyStart).Seconds())
+
+	if verifyOutput.ContentLength == nil || *verifyOutput.ContentLength != sourceSize {
+		return fmt.Errorf("verification failed for object %s: size mismatch (source: %d, dest: %d)",
+			key, sourceSize, aws.ToInt64(verifyOutput.ContentLength))
+	}
+
+	if !isCompositeChecksum(headOutput.ChecksumSHA256) && !isCompositeChecksum(verifyOutput.ChecksumSHA256) &&
+		headOutput.ChecksumSHA256 != nil && verifyOutput.ChecksumSHA256 != nil &&
+		*verifyOutput.ChecksumSHA256 != *headOutput.ChecksumSHA256 {
+		return fmt.Errorf("verification failed for object %s: S3 ChecksumSHA256 mismatch (source: %s, dest: %s)",
+			key, *headOutput.ChecksumSHA256, *verifyOutput.ChecksumSHA256)
+	}
+
+	destChecksum, err := downloadAndHash(ctx, destClient, destBucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to verify uploaded object %s: %w", key, err)
+	}
+	if destChecksum != sourceChecksum {
+		return fmt.Errorf("verification failed for object %s: SHA-256 mismatch (source: %s, dest: %s)",
+			key, sourceChecksum, destChecksum)
+	}
+
+	logger.WithFields(logrus.Fields{"bucket": destBucket, "key": key, "size": sourceSize, "sha256": sourceChecksum}).Info("Streamed, verified and copied large object")
+	return nil
+}
+
+// encodeTagging URL-encodes tagSet into the "key1=value1&key2=value2" form
+// PutObjectInput.Tagging expects. Unlike CopyObject's TaggingDirective, which
+// copies tags server-side, PutObject has no source to copy from and needs
+// the tag set spelled out explicitly.
+func encodeTagging(tagSet []types.Tag) string {
+	values := url.Values{}
+	for _, tag := range tagSet {
+		values.Set(aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+	return values.Encode()
+}
+
+// isCompositeChecksum reports whether checksum is S3's composite multipart
+// format ("<base64>-<N>"), which hashes each part's checksum rather than the
+// object's content and so can't be compared against a whole-object digest.
+func isCompositeChecksum(checksum *string) bool {
+	return checksum != nil && strings.Contains(*checksum, "-")
+}
+
+// downloadAndHash re-downloads the object at bucket/key to a temp file and
+// returns the hex SHA-256 of its content, for verifying the destination
+// actually received the bytes we uploaded rather than trusting S3's own
+// checksum metadata. Staged to disk rather than memory since this path
+// exists specifically for objects too large to buffer comfortably.
+func downloadAndHash(ctx context.Context, client *s3.Client, bucket, key string) (string, error) {
+	tmp, err := os.CreateTemp("", "s3-sync-verify-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create verification staging file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	downloader := manager.NewDownloader(client)
+	recordAPICall("GetObject")
+	if _, err := downloader.Download(ctx, tmp, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return "", fmt.Errorf("failed to download %s for verification: %w", key, err)
+	}
+
+	hasher := sha256.New()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind verification staging file for %s: %w", key, err)
+	}
+	if _, err := io.Copy(hasher, tmp); err != nil {
+		return "", fmt.Errorf("failed to checksum downloaded %s: %w", key, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/sirupsen/logrus"
+)
+
+// sourceVersionMetaKey is the destination object metadata key used to record
+// which source VersionId a replayed version came from, so re-runs can tell
+// whether a given (key, versionId) pair has already been synced without
+// re-copying it.
+const sourceVersionMetaKey = "s3-sync-source-version-id"
+
+// sourceLastModifiedMetaKey records the source version's original
+// LastModified timestamp (RFC 3339) on the replayed destination object,
+// since CopyObject gives the destination object its own LastModified (the
+// time of the copy), whatever the metadata directive.
+const sourceLastModifiedMetaKey = "s3-sync-source-last-modified"
+
+// deleteTombstonePrefix namespaces marker objects written to the
+// destination bucket to record which source delete-marker VersionIds have
+// already been replayed. Delete markers themselves can't carry metadata (a
+// HEAD on one 405s), so there's no way to tag them the way replayed content
+// versions are tagged; a small marker object under this prefix stands in for
+// that bookkeeping instead.
+const deleteTombstonePrefix = "__s3sync_tombstones__/"
+
+// versionEvent is a single chronological entry from ListObjectVersions:
+// either an object version or a delete marker for a key.
+type versionEvent struct {
+	key          string
+	versionID    string
+	isDeleteMark bool
+	lastModified *time.Time
+}
+
+// syncVersionedObjects replays every non-current version and delete marker
+// from the source bucket into the destination in chronological order, for
+// disaster-recovery-grade mirroring rather than current-version-only copy.
+func syncVersionedObjects(ctx context.Context, sourceClient, destClient *s3.Client, cfg Config) error {
+	events, err := listSourceVersionEvents(ctx, sourceClient, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to list source object versions: %w", err)
+	}
+
+	logger.WithField("count", len(events)).Info("Found version events in source bucket")
+
+	manifest, err := buildDestVersionManifest(ctx, destClient, cfg.Destination.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to build destination version manifest: %w", err)
+	}
+
+	var replayed, skipped, deleted int
+	for _, ev := range events {
+		if ev.isDeleteMark {
+			if manifest.deleted[ev.key][ev.versionID] {
+				skipped++
+				continue
+			}
+
+			recordAPICall("DeleteObject")
+			if _, err := destClient.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(cfg.Destination.Bucket),
+				Key:    aws.String(ev.key),
+			}); err != nil {
+				return fmt.Errorf("failed to replay delete marker for %s: %w", ev.key, err)
+			}
+			if err := recordDeleteTombstone(ctx, destClient, cfg.Destination.Bucket, ev.key, ev.versionID); err != nil {
+				return fmt.Errorf("failed to record delete marker replay for %s: %w", ev.key, err)
+			}
+			deleted++
+			continue
+		}
+
+		if manifest.synced[ev.key][ev.versionID] {
+			skipped++
+			continue
+		}
+
+		recordAPICall("HeadObject")
+		sourceHead, err := sourceClient.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    aws.String(cfg.Source.Bucket),
+			Key:       aws.String(ev.key),
+			VersionId: aws.String(ev.versionID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to head source version %s of %s: %w", ev.versionID, ev.key, err)
+		}
+
+		metadata := make(map[string]string, len(sourceHead.Metadata)+2)
+		for k, v := range sourceHead.Metadata {
+			metadata[k] = v
+		}
+		metadata[sourceVersionMetaKey] = ev.versionID
+		if ev.lastModified != nil {
+			metadata[sourceLastModifiedMetaKey] = ev.lastModified.UTC().Format(time.RFC3339Nano)
+		}
+
+		recordAPICall("GetObjectTagging")
+		tagOutput, err := sourceClient.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+			Bucket:    aws.String(cfg.Source.Bucket),
+			Key:       aws.String(ev.key),
+			VersionId: aws.String(ev.versionID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get tags for source version %s of %s: %w", ev.versionID, ev.key, err)
+		}
+
+		copySource := fmt.Sprintf("%s/%s?versionId=%s", cfg.Source.Bucket, ev.key, ev.versionID)
+		recordAPICall("CopyObject")
+		_, err = destClient.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(cfg.Destination.Bucket),
+			CopySource:        aws.String(copySource),
+			Key:               aws.String(ev.key),
+			MetadataDirective: types.MetadataDirectiveReplace,
+			Metadata:          metadata,
+			ContentType:       sourceHead.ContentType,
+			TaggingDirective:  types.TaggingDirectiveReplace,
+			Tagging:           aws.String(encodeTagging(tagOutput.TagSet)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to replay version %s of %s: %w", ev.versionID, ev.key, err)
+		}
+		objectsCopiedTotal.Inc()
+		replayed++
+	}
+
+	logger.WithFields(logrus.Fields{"replayed": replayed, "deleted": deleted, "skipped": skipped}).Info("Versioned synchronization completed")
+	return nil
+}
+
+// listSourceVersionEvents pages through ListObjectVersions for cfg's source
+// bucket, scoped to cfg.Prefix and filtered through matchesFilters, and
+// returns every matching version and delete marker, ordered chronologically
+// (oldest first) per key so replay into the destination preserves history.
+func listSourceVersionEvents(ctx context.Context, client *s3.Client, cfg Config) ([]versionEvent, error) {
+	var events []versionEvent
+
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(cfg.Source.Bucket), Prefix: aws.String(cfg.Prefix)}
+	for {
+		recordAPICall("ListObjectVersions")
+		output, err := client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range output.Versions {
+			if !matchesFilters(cfg, aws.ToString(v.Key)) {
+				continue
+			}
+			events = append(events, versionEvent{
+				key:          aws.ToString(v.Key),
+				versionID:    aws.ToString(v.VersionId),
+				lastModified: v.LastModified,
+			})
+		}
+		for _, m := range output.DeleteMarkers {
+			if !matchesFilters(cfg, aws.ToString(m.Key)) {
+				continue
+			}
+			events = append(events, versionEvent{
+				key:          aws.ToString(m.Key),
+				versionID:    aws.ToString(m.VersionId),
+				isDeleteMark: true,
+				lastModified: m.LastModified,
+			})
+		}
+
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		ti, tj := events[i].lastModified, events[j].lastModified
+		if ti == nil || tj == nil {
+			return false
+		}
+		return ti.Before(*tj)
+	})
+
+	return events, nil
+}
+
+// destVersionManifest records which source version events have already been
+// replayed into the destination bucket, so a re-run can skip them.
+type destVersionManifest struct {
+	// synced[key][sourceVersionID] marks a content version as replayed.
+	synced map[string]map[string]bool
+	// deleted[key][sourceVersionID] marks a delete marker as replayed.
+	deleted map[string]map[string]bool
+}
+
+// buildDestVersionManifest lists every already-replayed source VersionId
+// recorded on destination objects, keyed by object key, plus every replayed
+// delete marker recorded under deleteTombstonePrefix, so the caller can skip
+// events that were synced by a previous run.
+func buildDestVersionManifest(ctx context.Context, client *s3.Client, bucket string) (destVersionManifest, error) {
+	manifest := destVersionManifest{
+		synced:  make(map[string]map[string]bool),
+		deleted: make(map[string]map[string]bool),
+	}
+
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
+	for {
+		recordAPICall("ListObjectVersions")
+		output, err := client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return destVersionManifest{}, err
+		}
+
+		for _, v := range output.Versions {
+			key := aws.ToString(v.Key)
+			if tombstoneKey, versionID, ok := parseTombstoneKey(key); ok {
+				if manifest.deleted[tombstoneKey] == nil {
+					manifest.deleted[tombstoneKey] = make(map[string]bool)
+				}
+				manifest.deleted[tombstoneKey][versionID] = true
+				continue
+			}
+
+			recordAPICall("HeadObject")
+			headOutput, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket:    aws.String(bucket),
+				Key:       v.Key,
+				VersionId: v.VersionId,
+			})
+			if err != nil {
+				continue
+			}
+			sourceVersionID, ok := headOutput.Metadata[sourceVersionMetaKey]
+			if !ok {
+				continue
+			}
+			if manifest.synced[key] == nil {
+				manifest.synced[key] = make(map[string]bool)
+			}
+			manifest.synced[key][sourceVersionID] = true
+		}
+
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+
+	return manifest, nil
+}
+
+// recordDeleteTombstone writes a zero-byte marker object under
+// deleteTombstonePrefix recording that sourceVersionID's delete marker for
+// key has been replayed, so subsequent runs don't reissue DeleteObject for
+// it and pile up redundant delete markers in the destination.
+func recordDeleteTombstone(ctx context.Context, client *s3.Client, bucket, key, sourceVersionID string) error {
+	recordAPICall("PutObject")
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(deleteTombstonePrefix + key + "/" + sourceVersionID),
+	})
+	return err
+}
+
+// parseTombstoneKey reports whether key is a delete-tombstone marker
+// written by recordDeleteTombstone, returning the original object key and
+// source delete-marker VersionId it records.
+func parseTombstoneKey(key string) (origKey, sourceVersionID string, ok bool) {
+	rest, found := strings.CutPrefix(key, deleteTombstonePrefix)
+	if !found {
+		return "", "", false
+	}
+	idx := strings.LastIndex(rest, "/")
+	if idx < 0 {
+		return "", "", false
+	}
+	return rest[:idx], rest[idx+1:], true
+}